@@ -0,0 +1,97 @@
+package helm
+
+import (
+	tillerhelm "k8s.io/helm/pkg/helm"
+)
+
+// Bridge wraps the Tiller gRPC client Compass talks to for every release
+// operation a Stage needs.
+type Bridge struct {
+	client *tillerhelm.Client
+}
+
+// NewBridge connects to Tiller at host (e.g. "tiller-deploy.kube-system:44134").
+func NewBridge(host string) *Bridge {
+	return &Bridge{client: tillerhelm.NewClient(tillerhelm.Host(host))}
+}
+
+// ReleaseStatus returns the typed lifecycle status of releaseName, or an
+// error if it doesn't exist.
+func (b *Bridge) ReleaseStatus(releaseName string) (ReleaseStatus, error) {
+	resp, err := b.client.ReleaseStatus(releaseName)
+	if err != nil {
+		return Unknown, err
+	}
+	return ParseReleaseStatus(resp.Info.Status.Code.String()), nil
+}
+
+// InstallChart installs manifest as a new release of chart.
+func (b *Bridge) InstallChart(chart Chart, manifest []byte) error {
+	_, err := b.client.InstallRelease(chart.Repo, chart.Namespace,
+		tillerhelm.ReleaseName(chart.Release),
+		tillerhelm.ValueOverrides(manifest),
+		tillerhelm.InstallTimeout(int64(chart.EffectiveInstallTimeout().Seconds())))
+	return err
+}
+
+// UpgradeChart upgrades chart.Release in place to manifest.
+func (b *Bridge) UpgradeChart(chart Chart, manifest []byte) error {
+	_, err := b.client.UpdateRelease(chart.Release,
+		chart.Repo,
+		tillerhelm.UpdateValueOverrides(manifest),
+		tillerhelm.UpgradeTimeout(int64(chart.EffectiveUpgradeTimeout().Seconds())))
+	return err
+}
+
+// DeleteRelease purges releaseName, waiting up to chart's effective delete
+// timeout for Tiller to tear down the release's resources.
+func (b *Bridge) DeleteRelease(chart Chart, releaseName string) error {
+	_, err := b.client.DeleteRelease(releaseName,
+		tillerhelm.DeletePurge(true),
+		tillerhelm.DeleteTimeout(int64(chart.EffectiveDeleteTimeout().Seconds())))
+	return err
+}
+
+// RollbackRelease rolls releaseName back to its previous revision, so a
+// release stuck in FAILED can be reinstalled over cleanly. No revision is
+// named, so Tiller picks the one before the current; whether that
+// revision itself succeeded is not checked.
+func (b *Bridge) RollbackRelease(releaseName string) error {
+	_, err := b.client.RollbackRelease(releaseName)
+	return err
+}
+
+// GetReleaseManifest returns the manifest Tiller currently has recorded
+// as deployed for releaseName, for `compass diff` to compare against.
+func (b *Bridge) GetReleaseManifest(releaseName string) ([]byte, error) {
+	content, err := b.client.ReleaseContent(releaseName)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(content.Release.Manifest), nil
+}
+
+// InstallChartDryRun renders what InstallChart would do without
+// persisting anything, for `compass dry-run`.
+func (b *Bridge) InstallChartDryRun(chart Chart, manifest []byte) (string, error) {
+	resp, err := b.client.InstallRelease(chart.Repo, chart.Namespace,
+		tillerhelm.ReleaseName(chart.Release),
+		tillerhelm.ValueOverrides(manifest),
+		tillerhelm.InstallDryRun(true))
+	if err != nil {
+		return "", err
+	}
+	return resp.Release.Manifest, nil
+}
+
+// UpgradeChartDryRun renders what UpgradeChart would do without
+// persisting anything, for `compass dry-run`.
+func (b *Bridge) UpgradeChartDryRun(chart Chart, manifest []byte) (string, error) {
+	resp, err := b.client.UpdateRelease(chart.Release, chart.Repo,
+		tillerhelm.UpdateValueOverrides(manifest),
+		tillerhelm.UpgradeDryRun(true))
+	if err != nil {
+		return "", err
+	}
+	return resp.Release.Manifest, nil
+}
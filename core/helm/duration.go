@@ -0,0 +1,68 @@
+package helm
+
+import (
+	"fmt"
+	"time"
+)
+
+// Duration is a time.Duration that unmarshals from YAML strings such as
+// "5m" or "90s" rather than the bare integer-seconds Chart.Timeout used
+// to take.
+type Duration time.Duration
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw string
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(raw)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %v", raw, err)
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Duration returns the value as a standard time.Duration.
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+// EffectiveInstallTimeout returns InstallTimeout if set, falling back to
+// the chart's overall Timeout.
+func (c Chart) EffectiveInstallTimeout() time.Duration {
+	if c.InstallTimeout != 0 {
+		return c.InstallTimeout.Duration()
+	}
+	return c.Timeout.Duration()
+}
+
+// EffectiveUpgradeTimeout returns UpgradeTimeout if set, falling back to
+// the chart's overall Timeout.
+func (c Chart) EffectiveUpgradeTimeout() time.Duration {
+	if c.UpgradeTimeout != 0 {
+		return c.UpgradeTimeout.Duration()
+	}
+	return c.Timeout.Duration()
+}
+
+// EffectiveDeleteTimeout returns DeleteTimeout if set, falling back to
+// the chart's overall Timeout.
+func (c Chart) EffectiveDeleteTimeout() time.Duration {
+	if c.DeleteTimeout != 0 {
+		return c.DeleteTimeout.Duration()
+	}
+	return c.Timeout.Duration()
+}
+
+// EffectiveHookTimeout returns HookTimeout if set, falling back to the
+// chart's overall Timeout.
+func (c Chart) EffectiveHookTimeout() time.Duration {
+	if c.HookTimeout != 0 {
+		return c.HookTimeout.Duration()
+	}
+	return c.Timeout.Duration()
+}
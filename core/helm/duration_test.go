@@ -0,0 +1,50 @@
+package helm
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestDurationUnmarshalYAML(t *testing.T) {
+	cases := []struct {
+		name    string
+		raw     string
+		want    time.Duration
+		wantErr bool
+	}{
+		{name: "minutes", raw: "timeout: 5m", want: 5 * time.Minute},
+		{name: "seconds", raw: "timeout: 90s", want: 90 * time.Second},
+		{name: "explicit zero", raw: "timeout: 0s", want: 0},
+		{name: "invalid", raw: "timeout: not-a-duration", wantErr: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out struct {
+				Timeout Duration `yaml:"timeout"`
+			}
+			err := yaml.Unmarshal([]byte(c.raw), &out)
+			if c.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.want, out.Timeout.Duration())
+		})
+	}
+}
+
+func TestEffectiveTimeouts(t *testing.T) {
+	chart := Chart{
+		Timeout:        Duration(5 * time.Minute),
+		InstallTimeout: Duration(2 * time.Minute),
+	}
+
+	assert.Equal(t, 2*time.Minute, chart.EffectiveInstallTimeout())
+	assert.Equal(t, 5*time.Minute, chart.EffectiveUpgradeTimeout())
+	assert.Equal(t, 5*time.Minute, chart.EffectiveDeleteTimeout())
+	assert.Equal(t, 5*time.Minute, chart.EffectiveHookTimeout())
+}
@@ -0,0 +1,64 @@
+package helm
+
+// ReleaseStatus is the lifecycle state of a release as reported by Tiller,
+// typed so callers can switch on it instead of comparing against the raw
+// strings Tiller returns.
+type ReleaseStatus int
+
+// Release status codes, named after Tiller's release.Status_Code. The
+// numeric values are Compass's own, and Tiller's DELETING has no code
+// here: ParseReleaseStatus maps it to Unknown.
+const (
+	Unknown ReleaseStatus = iota
+	Deployed
+	Deleted
+	Superseded
+	Failed
+	PendingInstall
+	PendingUpgrade
+	PendingRollback
+)
+
+func (s ReleaseStatus) String() string {
+	switch s {
+	case Deployed:
+		return "DEPLOYED"
+	case Deleted:
+		return "DELETED"
+	case Superseded:
+		return "SUPERSEDED"
+	case Failed:
+		return "FAILED"
+	case PendingInstall:
+		return "PENDING_INSTALL"
+	case PendingUpgrade:
+		return "PENDING_UPGRADE"
+	case PendingRollback:
+		return "PENDING_ROLLBACK"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseReleaseStatus maps Tiller's raw status string to a ReleaseStatus,
+// returning Unknown for anything it doesn't recognise.
+func ParseReleaseStatus(raw string) ReleaseStatus {
+	switch raw {
+	case "DEPLOYED":
+		return Deployed
+	case "DELETED":
+		return Deleted
+	case "SUPERSEDED":
+		return Superseded
+	case "FAILED":
+		return Failed
+	case "PENDING_INSTALL":
+		return PendingInstall
+	case "PENDING_UPGRADE":
+		return PendingUpgrade
+	case "PENDING_ROLLBACK":
+		return PendingRollback
+	default:
+		return Unknown
+	}
+}
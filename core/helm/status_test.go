@@ -0,0 +1,52 @@
+package helm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseReleaseStatus(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want ReleaseStatus
+	}{
+		{"DEPLOYED", Deployed},
+		{"DELETED", Deleted},
+		{"SUPERSEDED", Superseded},
+		{"FAILED", Failed},
+		{"PENDING_INSTALL", PendingInstall},
+		{"PENDING_UPGRADE", PendingUpgrade},
+		{"PENDING_ROLLBACK", PendingRollback},
+		{"SOMETHING_ELSE", Unknown},
+		{"", Unknown},
+	}
+
+	for _, c := range cases {
+		t.Run(c.raw, func(t *testing.T) {
+			assert.Equal(t, c.want, ParseReleaseStatus(c.raw))
+		})
+	}
+}
+
+func TestReleaseStatusString(t *testing.T) {
+	cases := []struct {
+		status ReleaseStatus
+		want   string
+	}{
+		{Deployed, "DEPLOYED"},
+		{PendingRollback, "PENDING_ROLLBACK"},
+		{Unknown, "UNKNOWN"},
+		{ReleaseStatus(99), "UNKNOWN"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.want, c.status.String())
+	}
+}
+
+func TestParseReleaseStatusRoundTrip(t *testing.T) {
+	for _, status := range []ReleaseStatus{Deployed, Deleted, Superseded, Failed, PendingInstall, PendingUpgrade, PendingRollback} {
+		assert.Equal(t, status, ParseReleaseStatus(status.String()))
+	}
+}
@@ -0,0 +1,131 @@
+package kube
+
+import (
+	"bufio"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RunJob submits a batch/v1 Job into namespace running image with
+// command and env, streams its pod's logs to stdout as they arrive, and
+// blocks until it reports success or timeout elapses, reusing Waiter's
+// readiness predicate for Jobs. On failure it returns the terminated
+// container's message so a structured job spec doesn't need a kubectl
+// round trip to explain itself.
+func (k8s *K8s) RunJob(namespace, name, image string, command []string, env map[string]string, workdir string, timeout time.Duration) error {
+	envVars := make([]corev1.EnvVar, 0, len(env))
+	for k, v := range env {
+		envVars = append(envVars, corev1.EnvVar{Name: k, Value: v})
+	}
+	backoffLimit := int32(0)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: name + "-",
+			Namespace:    namespace,
+		},
+		Spec: batchv1.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: corev1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"compass-job": name}},
+				Spec: corev1.PodSpec{
+					RestartPolicy: corev1.RestartPolicyNever,
+					Containers: []corev1.Container{{
+						Name:       name,
+						Image:      image,
+						Command:    command,
+						Env:        envVars,
+						WorkingDir: workdir,
+					}},
+				},
+			},
+		},
+	}
+
+	created, err := k8s.client.Batch().Jobs(namespace).Create(job)
+	if err != nil {
+		return fmt.Errorf("failed to submit job %s: %v", name, err)
+	}
+
+	done := make(chan struct{})
+	go k8s.followPodLogs(namespace, created.Name, done)
+	defer close(done)
+
+	if err := NewWaiter(k8s).WaitForJob(namespace, created.Name, timeout); err != nil {
+		return fmt.Errorf("job %s failed: %s", name, k8s.terminationMessage(namespace, created.Name))
+	}
+	return nil
+}
+
+// followPodLogs waits for the job's pod to appear (giving up if done is
+// closed first), then streams its logs to stdout until the stream ends;
+// done is not checked once streaming has begun. It runs in its own
+// goroutine so RunJob can poll for completion at the same time, and
+// Follow:true means the full log is printed rather than whatever few
+// lines existed at a single poll.
+func (k8s *K8s) followPodLogs(namespace, jobName string, done <-chan struct{}) {
+	var pod string
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+
+		found, err := k8s.findJobPod(namespace, jobName)
+		if err == nil {
+			pod = found
+			break
+		}
+		time.Sleep(2 * time.Second)
+	}
+
+	stream, err := k8s.client.Core().Pods(namespace).GetLogs(pod, &corev1.PodLogOptions{Follow: true}).Stream()
+	if err != nil {
+		return
+	}
+	defer stream.Close()
+
+	scanner := bufio.NewScanner(stream)
+	for scanner.Scan() {
+		fmt.Println(scanner.Text())
+	}
+}
+
+// terminationMessage returns the message from the first terminated
+// container in jobName's pod, for surfacing why a Kubernetes job failed.
+func (k8s *K8s) terminationMessage(namespace, jobName string) string {
+	pod, err := k8s.findJobPod(namespace, jobName)
+	if err != nil {
+		return err.Error()
+	}
+
+	status, err := k8s.client.Core().Pods(namespace).Get(pod, metav1.GetOptions{})
+	if err != nil {
+		return err.Error()
+	}
+
+	for _, cs := range status.Status.ContainerStatuses {
+		if cs.State.Terminated != nil {
+			return cs.State.Terminated.Message
+		}
+	}
+	return "no termination message available"
+}
+
+func (k8s *K8s) findJobPod(namespace, jobName string) (string, error) {
+	pods, err := k8s.client.Core().Pods(namespace).List(metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("job-name=%s", jobName),
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(pods.Items) == 0 {
+		return "", fmt.Errorf("no pod found for job %s", jobName)
+	}
+	return pods.Items[0].Name, nil
+}
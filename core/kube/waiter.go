@@ -0,0 +1,189 @@
+package kube
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/wait"
+	k8syaml "k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// manifestResource is the minimal shape we need out of a rendered
+// manifest document to pick a readiness predicate for it.
+type manifestResource struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+}
+
+// Waiter polls the API server for the resources produced by a rendered
+// chart until each one satisfies its kind's readiness predicate, or the
+// caller's timeout elapses.
+type Waiter struct {
+	k8s *K8s
+}
+
+// NewWaiter returns a Waiter bound to the given cluster connection.
+func NewWaiter(k8s *K8s) *Waiter {
+	return &Waiter{k8s: k8s}
+}
+
+// Wait blocks until every resource decoded from manifest reports ready,
+// polling every 2 seconds, or returns an error once timeout elapses for
+// the first resource that doesn't. namespace is used as a fallback for
+// documents that don't set metadata.namespace.
+func (w *Waiter) Wait(namespace string, manifest []byte, timeout time.Duration) error {
+	for _, doc := range splitManifest(manifest) {
+		var res manifestResource
+		if err := k8syaml.Unmarshal(doc, &res); err != nil || res.Kind == "" {
+			continue
+		}
+
+		ns := res.Metadata.Namespace
+		if ns == "" {
+			ns = namespace
+		}
+
+		ready, ok := w.predicate(res.Kind, ns, res.Metadata.Name)
+		if !ok {
+			continue
+		}
+
+		if err := wait.PollImmediate(2*time.Second, timeout, ready); err != nil {
+			return fmt.Errorf("%s/%s not ready after %s: %v", res.Kind, res.Metadata.Name, timeout, err)
+		}
+	}
+	return nil
+}
+
+// WaitForJob blocks until the named batch/v1 Job reports success,
+// reusing the same "Job" predicate Wait uses for Jobs found in a
+// rendered chart manifest, so job execution and post-install readiness
+// share one readiness notion instead of two.
+func (w *Waiter) WaitForJob(namespace, name string, timeout time.Duration) error {
+	ready, _ := w.predicate("Job", namespace, name)
+	return wait.PollImmediate(2*time.Second, timeout, ready)
+}
+
+// predicate returns the wait.ConditionFunc for a given kind, and false if
+// the kind has no readiness notion we track.
+func (w *Waiter) predicate(kind, namespace, name string) (wait.ConditionFunc, bool) {
+	client := w.k8s.client
+	switch kind {
+	case "Pod":
+		return func() (bool, error) {
+			pod, err := client.Core().Pods(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			return podReady(pod), nil
+		}, true
+	case "Deployment":
+		return func() (bool, error) {
+			dep, err := client.Apps().Deployments(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			return deploymentReady(dep), nil
+		}, true
+	case "StatefulSet":
+		return func() (bool, error) {
+			ss, err := client.Apps().StatefulSets(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			replicas := int32(1)
+			if ss.Spec.Replicas != nil {
+				replicas = *ss.Spec.Replicas
+			}
+			return ss.Status.ObservedGeneration >= ss.Generation &&
+				ss.Status.UpdatedReplicas == replicas &&
+				ss.Status.ReadyReplicas >= replicas, nil
+		}, true
+	case "DaemonSet":
+		return func() (bool, error) {
+			ds, err := client.Apps().DaemonSets(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			return ds.Status.ObservedGeneration >= ds.Generation &&
+				ds.Status.UpdatedNumberScheduled == ds.Status.DesiredNumberScheduled &&
+				ds.Status.NumberAvailable >= ds.Status.DesiredNumberScheduled, nil
+		}, true
+	case "PersistentVolumeClaim":
+		return func() (bool, error) {
+			pvc, err := client.Core().PersistentVolumeClaims(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			return pvc.Status.Phase == corev1.ClaimBound, nil
+		}, true
+	case "Service":
+		return func() (bool, error) {
+			svc, err := client.Core().Services(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+				return true, nil
+			}
+			return len(svc.Status.LoadBalancer.Ingress) > 0, nil
+		}, true
+	case "Job":
+		return func() (bool, error) {
+			job, err := client.Batch().Jobs(namespace).Get(name, metav1.GetOptions{})
+			if err != nil {
+				return false, nil
+			}
+			if job.Status.Failed >= 1 {
+				return false, fmt.Errorf("job %s/%s failed", namespace, name)
+			}
+			return job.Status.Succeeded >= 1, nil
+		}, true
+	default:
+		return nil, false
+	}
+}
+
+func podReady(pod *corev1.Pod) bool {
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == corev1.PodReady {
+			return cond.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+func deploymentReady(dep *appsv1.Deployment) bool {
+	if dep.Status.ObservedGeneration < dep.Generation {
+		return false
+	}
+
+	replicas := int32(1)
+	if dep.Spec.Replicas != nil {
+		replicas = *dep.Spec.Replicas
+	}
+
+	var maxUnavailable int32
+	if dep.Spec.Strategy.RollingUpdate != nil && dep.Spec.Strategy.RollingUpdate.MaxUnavailable != nil {
+		// RollingUpdate.MaxUnavailable defaults to the string "25%", so
+		// this must resolve the percentage form too, not just IntVal.
+		value, err := intstr.GetValueFromIntOrPercent(dep.Spec.Strategy.RollingUpdate.MaxUnavailable, int(replicas), false)
+		if err == nil {
+			maxUnavailable = int32(value)
+		}
+	}
+
+	return dep.Status.UpdatedReplicas == replicas && dep.Status.AvailableReplicas >= replicas-maxUnavailable
+}
+
+func splitManifest(manifest []byte) [][]byte {
+	return bytes.Split(manifest, []byte("\n---\n"))
+}
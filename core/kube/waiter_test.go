@@ -0,0 +1,173 @@
+package kube
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestWaiterPredicatePod(t *testing.T) {
+	k8s := newTestK8s()
+	namespace := "kube-system"
+	assert.NoError(t, createFakeNamespace(k8s, namespace))
+
+	notReady := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "not-ready"},
+		Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}}},
+	}
+	_, err := k8s.client.Core().Pods(namespace).Create(notReady)
+	assert.NoError(t, err)
+
+	ready := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "ready"},
+		Status:     v1.PodStatus{Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}},
+	}
+	_, err = k8s.client.Core().Pods(namespace).Create(ready)
+	assert.NoError(t, err)
+
+	waiter := NewWaiter(k8s)
+
+	check, ok := waiter.predicate("Pod", namespace, "not-ready")
+	assert.True(t, ok)
+	done, err := check()
+	assert.NoError(t, err)
+	assert.False(t, done)
+
+	check, ok = waiter.predicate("Pod", namespace, "ready")
+	assert.True(t, ok)
+	done, err = check()
+	assert.NoError(t, err)
+	assert.True(t, done)
+}
+
+func TestWaiterPredicateDeployment(t *testing.T) {
+	k8s := newTestK8s()
+	namespace := "kube-system"
+	assert.NoError(t, createFakeNamespace(k8s, namespace))
+
+	replicas := int32(3)
+	dep := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Generation: 2},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration: 1, // stale: controller hasn't caught up yet
+			UpdatedReplicas:    3,
+			AvailableReplicas:  3,
+		},
+	}
+	_, err := k8s.client.Apps().Deployments(namespace).Create(dep)
+	assert.NoError(t, err)
+
+	waiter := NewWaiter(k8s)
+	check, ok := waiter.predicate("Deployment", namespace, "web")
+	assert.True(t, ok)
+
+	done, err := check()
+	assert.NoError(t, err)
+	assert.False(t, done, "stale observedGeneration must not read as ready")
+
+	dep.Status.ObservedGeneration = 2
+	_, err = k8s.client.Apps().Deployments(namespace).Update(dep)
+	assert.NoError(t, err)
+
+	done, err = check()
+	assert.NoError(t, err)
+	assert.True(t, done)
+}
+
+func TestWaiterPredicatePVC(t *testing.T) {
+	k8s := newTestK8s()
+	namespace := "kube-system"
+	assert.NoError(t, createFakeNamespace(k8s, namespace))
+
+	pvc := &v1.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{Name: "data"},
+		Status:     v1.PersistentVolumeClaimStatus{Phase: v1.ClaimPending},
+	}
+	_, err := k8s.client.Core().PersistentVolumeClaims(namespace).Create(pvc)
+	assert.NoError(t, err)
+
+	waiter := NewWaiter(k8s)
+	check, ok := waiter.predicate("PersistentVolumeClaim", namespace, "data")
+	assert.True(t, ok)
+
+	done, err := check()
+	assert.NoError(t, err)
+	assert.False(t, done)
+
+	pvc.Status.Phase = v1.ClaimBound
+	_, err = k8s.client.Core().PersistentVolumeClaims(namespace).Update(pvc)
+	assert.NoError(t, err)
+
+	done, err = check()
+	assert.NoError(t, err)
+	assert.True(t, done)
+}
+
+func TestWaiterPredicateJob(t *testing.T) {
+	k8s := newTestK8s()
+	namespace := "kube-system"
+	assert.NoError(t, createFakeNamespace(k8s, namespace))
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate"}}
+	_, err := k8s.client.Batch().Jobs(namespace).Create(job)
+	assert.NoError(t, err)
+
+	waiter := NewWaiter(k8s)
+	check, ok := waiter.predicate("Job", namespace, "migrate")
+	assert.True(t, ok)
+
+	done, err := check()
+	assert.NoError(t, err)
+	assert.False(t, done)
+
+	job.Status.Succeeded = 1
+	_, err = k8s.client.Batch().Jobs(namespace).Update(job)
+	assert.NoError(t, err)
+
+	done, err = check()
+	assert.NoError(t, err)
+	assert.True(t, done)
+}
+
+func TestWaiterPredicateJobFailure(t *testing.T) {
+	k8s := newTestK8s()
+	namespace := "kube-system"
+	assert.NoError(t, createFakeNamespace(k8s, namespace))
+
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: "migrate"}}
+	_, err := k8s.client.Batch().Jobs(namespace).Create(job)
+	assert.NoError(t, err)
+
+	waiter := NewWaiter(k8s)
+	check, ok := waiter.predicate("Job", namespace, "migrate")
+	assert.True(t, ok)
+
+	job.Status.Failed = 1
+	_, err = k8s.client.Batch().Jobs(namespace).Update(job)
+	assert.NoError(t, err)
+
+	done, err := check()
+	assert.Error(t, err, "a failed job must short-circuit rather than poll out the full timeout")
+	assert.False(t, done)
+}
+
+func TestWaiterPredicateUnknownKind(t *testing.T) {
+	waiter := NewWaiter(newTestK8s())
+	_, ok := waiter.predicate("ConfigMap", "kube-system", "anything")
+	assert.False(t, ok)
+}
+
+func TestWaiterWaitSkipsUntrackedKinds(t *testing.T) {
+	k8s := newTestK8s()
+	waiter := NewWaiter(k8s)
+
+	manifest := []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: cfg\n")
+	err := waiter.Wait("kube-system", manifest, 100*time.Millisecond)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+
+	"github.com/monax/compass/core/docker"
+	"github.com/monax/compass/core/kube"
+)
+
+// FuncProvider contributes a named family of template functions. Pipeline
+// authors opt into a provider with the top-level `providers:` list, so
+// adding a new secret backend doesn't require forking Compass.
+type FuncProvider interface {
+	Name() string
+	Funcs() template.FuncMap
+}
+
+var providers = map[string]FuncProvider{}
+
+// RegisterProvider adds a FuncProvider to the registry under its Name(),
+// overwriting any provider previously registered with that name.
+func RegisterProvider(p FuncProvider) {
+	providers[p.Name()] = p
+}
+
+func init() {
+	RegisterProvider(envProvider{})
+	RegisterProvider(dockerProvider{})
+	RegisterProvider(kubeProvider{kube.NewK8s()})
+	RegisterProvider(vaultProvider{})
+	RegisterProvider(awsProvider{})
+	RegisterProvider(httpProvider{})
+	RegisterProvider(sopsProvider{})
+}
+
+// defaultProviders are enabled when a pipeline sets no `providers:`
+// list, so templates written before providers existed keep rendering
+// with the functions they've always had.
+var defaultProviders = []string{"env", "docker", "kube"}
+
+// providerFuncMap builds the template.FuncMap for the given provider
+// names, erroring on an unknown name so a typo in `providers:` fails the
+// stage instead of silently rendering an empty value.
+func providerFuncMap(names []string) (template.FuncMap, error) {
+	if len(names) == 0 {
+		names = defaultProviders
+	}
+
+	out := template.FuncMap{}
+	for _, name := range names {
+		p, ok := providers[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown template provider %q", name)
+		}
+		for fn, impl := range p.Funcs() {
+			out[fn] = impl
+		}
+	}
+	return out, nil
+}
+
+// envProvider exposes readEnv, the original built-in.
+type envProvider struct{}
+
+func (envProvider) Name() string { return "env" }
+func (envProvider) Funcs() template.FuncMap {
+	return template.FuncMap{"readEnv": os.Getenv}
+}
+
+// dockerProvider exposes getDigest/getAuth, the original built-ins.
+type dockerProvider struct{}
+
+func (dockerProvider) Name() string { return "docker" }
+func (dockerProvider) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"getDigest": docker.GetImageHash,
+		"getAuth":   docker.GetAuthToken,
+	}
+}
+
+// kubeProvider exposes fromConfigMap/fromSecret/parseJSON, the original
+// built-ins.
+type kubeProvider struct {
+	k8s *kube.K8s
+}
+
+func (kubeProvider) Name() string { return "kube" }
+func (p kubeProvider) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"fromConfigMap": p.k8s.FromConfigMap,
+		"fromSecret":    p.k8s.FromSecret,
+		"parseJSON":     kube.ParseJSON,
+	}
+}
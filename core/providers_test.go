@@ -0,0 +1,30 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProviderFuncMapDefaultsWhenEmpty(t *testing.T) {
+	funcMap, err := providerFuncMap(nil)
+	assert.NoError(t, err)
+
+	for _, fn := range []string{"readEnv", "getDigest", "getAuth", "fromConfigMap", "fromSecret", "parseJSON"} {
+		assert.Contains(t, funcMap, fn)
+	}
+	// vault/aws/http/sops are opt-in only, never defaulted.
+	assert.NotContains(t, funcMap, "vault")
+}
+
+func TestProviderFuncMapExplicitList(t *testing.T) {
+	funcMap, err := providerFuncMap([]string{"vault"})
+	assert.NoError(t, err)
+	assert.Contains(t, funcMap, "vault")
+	assert.NotContains(t, funcMap, "readEnv", "an explicit list replaces the defaults rather than adding to them")
+}
+
+func TestProviderFuncMapUnknownProvider(t *testing.T) {
+	_, err := providerFuncMap([]string{"nope"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,162 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	"go.mozilla.org/sops/v3/decrypt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+// vaultProvider exposes vault, which reads a single key out of a KV
+// secret at path, authenticating via VAULT_ADDR/VAULT_TOKEN.
+type vaultProvider struct{}
+
+func (vaultProvider) Name() string { return "vault" }
+func (vaultProvider) Funcs() template.FuncMap {
+	return template.FuncMap{"vault": vaultRead}
+}
+
+func vaultRead(path, key string) (string, error) {
+	client, err := vaultapi.NewClient(vaultapi.DefaultConfig())
+	if err != nil {
+		return "", fmt.Errorf("vault client: %v", err)
+	}
+	client.SetToken(os.Getenv("VAULT_TOKEN"))
+
+	secret, err := client.Logical().Read(path)
+	if err != nil {
+		return "", fmt.Errorf("vault read %s: %v", path, err)
+	}
+	if secret == nil {
+		return "", fmt.Errorf("vault path %s not found", path)
+	}
+
+	data := secret.Data
+	if kv2, ok := data["data"].(map[string]interface{}); ok {
+		data = kv2 // KV v2 nests the payload under "data"
+	}
+
+	value, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("vault path %s has no key %q", path, key)
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// awsProvider exposes awsSecret and awsParam, backed by Secrets Manager
+// and SSM Parameter Store, using the default AWS credential chain.
+type awsProvider struct{}
+
+func (awsProvider) Name() string { return "aws" }
+func (awsProvider) Funcs() template.FuncMap {
+	return template.FuncMap{
+		"awsSecret": awsSecretValue,
+		"awsParam":  awsParamValue,
+	}
+}
+
+func awsSession() (*session.Session, error) {
+	return session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable})
+}
+
+func awsSecretValue(name string) (string, error) {
+	sess, err := awsSession()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := secretsmanager.New(sess).GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if err != nil {
+		return "", fmt.Errorf("aws secret %s: %v", name, err)
+	}
+	if out.SecretString == nil {
+		return "", fmt.Errorf("aws secret %s has no string value", name)
+	}
+	return *out.SecretString, nil
+}
+
+func awsParamValue(name string) (string, error) {
+	sess, err := awsSession()
+	if err != nil {
+		return "", err
+	}
+
+	out, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("aws param %s: %v", name, err)
+	}
+	return *out.Parameter.Value, nil
+}
+
+// httpProvider exposes httpGet, which fetches a URL and optionally pulls
+// a single top-level field out of a JSON response.
+type httpProvider struct{}
+
+func (httpProvider) Name() string { return "http" }
+func (httpProvider) Funcs() template.FuncMap {
+	return template.FuncMap{"httpGet": httpGetValue}
+}
+
+func httpGetValue(url string, jsonField ...string) (string, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return "", fmt.Errorf("http get %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return "", fmt.Errorf("http get %s: server returned %s", url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("http get %s: %v", url, err)
+	}
+
+	if len(jsonField) == 0 {
+		return string(body), nil
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return "", fmt.Errorf("http get %s: not JSON: %v", url, err)
+	}
+
+	value, ok := parsed[jsonField[0]]
+	if !ok {
+		return "", fmt.Errorf("http get %s: no field %q", url, jsonField[0])
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// sopsProvider exposes sops, which decrypts a SOPS-encrypted file and
+// returns its plaintext.
+type sopsProvider struct{}
+
+func (sopsProvider) Name() string { return "sops" }
+func (sopsProvider) Funcs() template.FuncMap {
+	return template.FuncMap{"sops": sopsDecryptFile}
+}
+
+func sopsDecryptFile(path string) (string, error) {
+	plain, err := decrypt.File(path, "")
+	if err != nil {
+		return "", fmt.Errorf("sops decrypt %s: %v", path, err)
+	}
+	return string(plain), nil
+}
@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"html/template"
@@ -9,17 +10,46 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"strings"
+	"path/filepath"
+	"time"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"k8s.io/apimachinery/pkg/util/wait"
 
-	"github.com/monax/compass/core/docker"
 	"github.com/monax/compass/core/helm"
 	"github.com/monax/compass/core/kube"
 )
 
-// Jobs represent any shell scripts
+// releaseClient is the subset of *helm.Bridge a Stage drives a release
+// through. It exists so tests can substitute a fake instead of dialing a
+// real Tiller instance; *helm.Bridge satisfies it as-is.
+type releaseClient interface {
+	ReleaseStatus(releaseName string) (helm.ReleaseStatus, error)
+	InstallChart(chart helm.Chart, manifest []byte) error
+	UpgradeChart(chart helm.Chart, manifest []byte) error
+	DeleteRelease(chart helm.Chart, releaseName string) error
+	RollbackRelease(releaseName string) error
+	GetReleaseManifest(releaseName string) ([]byte, error)
+	InstallChartDryRun(chart helm.Chart, manifest []byte) (string, error)
+	UpgradeChartDryRun(chart helm.Chart, manifest []byte) (string, error)
+}
+
+// Job is a single before/after hook, run either on the operator's
+// machine or in-cluster as a Kubernetes Job.
+type Job struct {
+	Name    string            `yaml:"name"`
+	Command []string          `yaml:"command"`
+	Image   string            `yaml:"image"` // required when RunIn is "kubernetes"
+	Env     map[string]string `yaml:"env"`
+	Workdir string            `yaml:"workdir"`
+	Timeout helm.Duration     `yaml:"timeout"`
+	RunIn   string            `yaml:"runIn"` // local|kubernetes, defaults to local
+}
+
+// Jobs represent the before/after hooks run as part of a release.
 type Jobs struct {
-	Before []string `yaml:"before"`
-	After  []string `yaml:"after"`
+	Before []Job `yaml:"before"`
+	After  []Job `yaml:"after"`
 }
 
 // Stage represents a single part of the deployment pipeline
@@ -29,49 +59,51 @@ type Stage struct {
 	Values     string   `yaml:"values"`    // env specific values
 	Requires   []string `yaml:"requires"`  // env requirements
 	Depends    []string `yaml:"depends"`   // dependencies
-	Jobs       Jobs     `yaml:"jobs"`      // bash jobs
+	Jobs       Jobs     `yaml:"jobs"`      // before/after hooks
 	Templates  []string `yaml:"templates"` // templates
+	OnPending  string   `yaml:"onPending"` // wait|purge|abort when the release is PENDING_UPGRADE/PENDING_ROLLBACK
+	Providers  []string `yaml:"providers"` // template func providers enabled for this stage
+	Mode       string   `yaml:"mode"`      // apply|render|diff|dry-run, defaults to apply
+	Output     string   `yaml:"output"`    // output dir for render mode; stdout if empty
 }
 
-// Generate renders the given values template
-func Generate(name string, data, out *[]byte, values map[string]string) {
-	k8s := kube.NewK8s()
-
-	funcMap := template.FuncMap{
-		"readEnv":       os.Getenv,
-		"getDigest":     docker.GetImageHash,
-		"getAuth":       docker.GetAuthToken,
-		"fromConfigMap": k8s.FromConfigMap,
-		"fromSecret":    k8s.FromSecret,
-		"parseJSON":     kube.ParseJSON,
+// Generate renders the given values template using the named providers'
+// template functions. It returns an error instead of aborting the whole
+// pipeline, so a missing secret only fails the offending stage.
+func Generate(name string, data, out *[]byte, values map[string]string, providerNames []string) error {
+	funcMap, err := providerFuncMap(providerNames)
+	if err != nil {
+		return fmt.Errorf("failed to render %s: %v", name, err)
 	}
 
 	t, err := template.New(name).Funcs(funcMap).Parse(string(*data))
 	if err != nil {
-		log.Fatalf("failed to render %s : %s\n", name, err)
+		return fmt.Errorf("failed to render %s: %v", name, err)
 	}
 
 	buf := new(bytes.Buffer)
-	err = t.Execute(buf, values)
-	if err != nil {
-		log.Fatalf("failed to render %s : %s\n", name, err)
+	if err := t.Execute(buf, values); err != nil {
+		return fmt.Errorf("failed to render %s: %v", name, err)
 	}
 	*out = append(*out, buf.Bytes()...)
+	return nil
 }
 
 // Extrapolate renders a template and reads it to a map
-func Extrapolate(tpl string, values map[string]string) map[string]string {
+func Extrapolate(tpl string, values map[string]string, providerNames []string) (map[string]string, error) {
 	if tpl == "" {
-		return values
+		return values, nil
 	}
 	data, err := ioutil.ReadFile(tpl)
 	if err != nil {
-		log.Fatalf("couldn't read from %s\n", tpl)
+		return nil, fmt.Errorf("couldn't read from %s: %v", tpl, err)
 	}
 	var out []byte
-	Generate(tpl, &data, &out, values)
+	if err := Generate(tpl, &data, &out, values, providerNames); err != nil {
+		return nil, err
+	}
 	MergeVals(values, LoadVals(tpl, out))
-	return values
+	return values, nil
 }
 
 func shellVars(vals map[string]string) []string {
@@ -82,15 +114,26 @@ func shellVars(vals map[string]string) []string {
 	return envs
 }
 
-func shellJobs(values []string, jobs []string, verbose bool) error {
-	for _, command := range jobs {
-		log.Printf("running job: %s\n", command)
-		args := strings.Fields(command)
-		cmd := exec.Command(args[0], args[1:]...)
-		cmd.Env = append(values, os.Environ()...)
-		stdout, err := cmd.Output()
-		if verbose && stdout != nil {
-			fmt.Println(string(stdout))
+// runJobs executes each job in order, dispatching to the operator's
+// machine or in-cluster based on job.RunIn, and stops at the first
+// failure.
+func runJobs(namespace string, values []string, jobs []Job, defaultTimeout time.Duration, verbose bool) error {
+	for _, job := range jobs {
+		log.Printf("running job: %s\n", job.Name)
+
+		timeout := job.Timeout.Duration()
+		if timeout == 0 {
+			timeout = defaultTimeout
+		}
+
+		var err error
+		switch job.RunIn {
+		case "", "local":
+			err = runLocalJob(values, job, timeout, verbose)
+		case "kubernetes":
+			err = kube.NewK8s().RunJob(namespace, job.Name, job.Image, job.Command, job.Env, job.Workdir, timeout)
+		default:
+			err = fmt.Errorf("unknown runIn %q for job %s", job.RunIn, job.Name)
 		}
 		if err != nil {
 			return err
@@ -99,6 +142,33 @@ func shellJobs(values []string, jobs []string, verbose bool) error {
 	return nil
 }
 
+// runLocalJob executes job.Command as a structured argv on the
+// operator's machine, so quoted arguments reach the program intact
+// instead of being re-split on whitespace. No shell is involved: pipes
+// and variable expansion only happen if Command itself invokes a shell.
+func runLocalJob(values []string, job Job, timeout time.Duration, verbose bool) error {
+	if len(job.Command) == 0 {
+		return fmt.Errorf("job %s has no command", job.Name)
+	}
+
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, job.Command[0], job.Command[1:]...)
+	cmd.Dir = job.Workdir
+	cmd.Env = append(append(values, os.Environ()...), shellVars(job.Env)...)
+
+	stdout, err := cmd.Output()
+	if verbose && stdout != nil {
+		fmt.Println(string(stdout))
+	}
+	return err
+}
+
 func checkRequires(values map[string]string, reqs []string) error {
 	for _, r := range reqs {
 		if _, exists := values[r]; !exists {
@@ -118,7 +188,7 @@ func cpVals(prev map[string]string) map[string]string {
 }
 
 // Destroy deletes the chart once its dependencies have been met
-func (stage *Stage) Destroy(conn *helm.Bridge, key string, values map[string]string, verbose bool, deps *Depends) error {
+func (stage *Stage) Destroy(conn releaseClient, key string, values map[string]string, verbose bool, deps *Depends) error {
 	defer deps.Complete(stage.Depends...)
 
 	err := checkRequires(values, stage.Requires)
@@ -128,11 +198,14 @@ func (stage *Stage) Destroy(conn *helm.Bridge, key string, values map[string]str
 
 	deps.Wait(key)
 	log.Printf("deleting %s\n", stage.Release)
-	return conn.DeleteRelease(stage.Release)
+	return conn.DeleteRelease(stage.Chart, stage.Release)
 }
 
-// Create deploys the chart once its dependencies have been met
-func (stage *Stage) Create(conn *helm.Bridge, key string, main map[string]string, verbose bool, deps *Depends) error {
+// Create deploys the chart once its dependencies have been met.
+// pipelineProviders is the pipeline's top-level `providers:` list; a
+// stage that sets its own Providers overrides it entirely rather than
+// merging with it.
+func (stage *Stage) Create(conn releaseClient, key string, main map[string]string, pipelineProviders []string, verbose bool, deps *Depends) error {
 	defer deps.Complete(key)
 
 	_, err := conn.ReleaseStatus(stage.Release)
@@ -152,42 +225,240 @@ func (stage *Stage) Create(conn *helm.Bridge, key string, main map[string]string
 
 	deps.Wait(stage.Depends...)
 
-	shellJobs(shellVars(values), stage.Jobs.Before, verbose)
-	defer shellJobs(shellVars(values), stage.Jobs.After, verbose)
+	// render/diff/dry-run must not touch the cluster, so before/after
+	// jobs - especially runIn: kubernetes ones that submit real batch
+	// Jobs - only run in the default apply mode.
+	applying := stage.Mode == "" || stage.Mode == "apply"
+
+	if applying {
+		if err := runJobs(stage.Namespace, shellVars(values), stage.Jobs.Before, stage.EffectiveHookTimeout(), verbose); err != nil {
+			return fmt.Errorf("before job failed for %s: %v", stage.Release, err)
+		}
+		defer func() {
+			if err := runJobs(stage.Namespace, shellVars(values), stage.Jobs.After, stage.EffectiveHookTimeout(), verbose); err != nil {
+				log.Printf("after job failed for %s: %v\n", stage.Release, err)
+			}
+		}()
+	}
+
+	providerNames := stage.Providers
+	if len(providerNames) == 0 {
+		providerNames = pipelineProviders
+	}
 
 	var out []byte
 	for _, temp := range stage.Templates {
 		data, read := ioutil.ReadFile(temp)
 		if read != nil {
-			panic(read)
+			return fmt.Errorf("couldn't read template %s: %v", temp, read)
+		}
+		if err := Generate(temp, &data, &out, values, providerNames); err != nil {
+			return err
 		}
-		Generate(temp, &data, &out, values)
 	}
 
 	if verbose {
 		fmt.Println(string(out))
 	}
 
+	switch stage.Mode {
+	case "", "apply":
+		// fall through to the normal install/upgrade logic below
+	case "render":
+		return stage.render(key, out)
+	case "diff":
+		return stage.diff(conn, out)
+	case "dry-run":
+		return stage.dryRun(conn, out)
+	default:
+		return fmt.Errorf("unknown mode %q for stage %s", stage.Mode, key)
+	}
+
 	status, err := conn.ReleaseStatus(stage.Release)
-	if status == "PENDING_INSTALL" || err != nil {
-		if err == nil {
-			log.Printf("deleting release: %s\n", stage.Release)
-			conn.DeleteRelease(stage.Release)
+	if err != nil {
+		return stage.install(conn, out, false)
+	}
+	return stage.applyStatus(conn, out, status)
+}
+
+// applyStatus drives the install/upgrade decision from release's current
+// status. PendingUpgrade/PendingRollback recurse once resolvePending has
+// settled the release, rather than assuming the outcome is an upgrade -
+// a purge deletes the release outright, and a wait can land on Failed
+// just as easily as Deployed.
+func (stage *Stage) applyStatus(conn releaseClient, out []byte, status helm.ReleaseStatus) error {
+	switch status {
+	case helm.Failed:
+		log.Printf("release %s previously failed, rolling back before reinstall\n", stage.Release)
+		if err := conn.RollbackRelease(stage.Release); err != nil {
+			return fmt.Errorf("failed to roll back %s: %v", stage.Release, err)
+		}
+		return stage.install(conn, out, true)
+
+	case helm.PendingInstall:
+		return stage.install(conn, out, true)
+
+	case helm.PendingUpgrade, helm.PendingRollback:
+		if err := stage.resolvePending(conn, status); err != nil {
+			return err
 		}
-		log.Printf("installing release: %s\n", stage.Release)
-		err := conn.InstallChart(stage.Chart, out)
+
+		settled, err := conn.ReleaseStatus(stage.Release)
 		if err != nil {
-			log.Fatalf("failed to install %s : %s\n", stage.Release, err)
+			// onPending: purge deleted it out from under us.
+			return stage.install(conn, out, false)
+		}
+		return stage.applyStatus(conn, out, settled)
+
+	default: // Deployed, Superseded, and any other status (Deleted, Unknown)
+		log.Printf("upgrading release: %s\n", stage.Release)
+		if err := conn.UpgradeChart(stage.Chart, out); err != nil {
+			return fmt.Errorf("failed to upgrade %s: %v", stage.Release, err)
+		}
+		log.Printf("release upgraded: %s\n", stage.Release)
+		return stage.waitReady(out)
+	}
+}
+
+// install installs out as a fresh release, deleting any existing
+// release first when deleteFirst is set (PENDING_INSTALL/FAILED).
+func (stage *Stage) install(conn releaseClient, out []byte, deleteFirst bool) error {
+	if deleteFirst {
+		log.Printf("deleting release: %s\n", stage.Release)
+		if err := conn.DeleteRelease(stage.Chart, stage.Release); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", stage.Release, err)
 		}
-		log.Printf("release %s installed\n", stage.Release)
+	}
+
+	log.Printf("installing release: %s\n", stage.Release)
+	if err := conn.InstallChart(stage.Chart, out); err != nil {
+		return fmt.Errorf("failed to install %s: %v", stage.Release, err)
+	}
+	log.Printf("release %s installed\n", stage.Release)
+	return stage.waitReady(out)
+}
+
+// resolvePending acts on a release stuck in PENDING_UPGRADE or
+// PENDING_ROLLBACK according to the stage's OnPending policy, which
+// defaults to "abort" so Compass never guesses on a stuck release.
+func (stage *Stage) resolvePending(conn releaseClient, status helm.ReleaseStatus) error {
+	policy := stage.OnPending
+	if policy == "" {
+		policy = "abort"
+	}
+
+	switch policy {
+	case "wait":
+		log.Printf("release %s is %s, waiting for it to settle\n", stage.Release, status)
+		return wait.PollImmediate(2*time.Second, stage.Timeout.Duration(), func() (bool, error) {
+			s, err := conn.ReleaseStatus(stage.Release)
+			if err != nil {
+				return false, err
+			}
+			return s != helm.PendingUpgrade && s != helm.PendingRollback, nil
+		})
+	case "purge":
+		log.Printf("release %s is %s, purging before reinstall\n", stage.Release, status)
+		return conn.DeleteRelease(stage.Chart, stage.Release)
+	case "abort":
+		return fmt.Errorf("release %s is %s and onPending is abort", stage.Release, status)
+	default:
+		return fmt.Errorf("unknown onPending policy %q", policy)
+	}
+}
+
+// waitReady blocks until the resources rendered for this stage report
+// ready, when the stage opted into it with Wait. It is a no-op otherwise,
+// so stages race ahead exactly as before unless asked not to.
+func (stage *Stage) waitReady(manifest []byte) error {
+	if !stage.Wait {
 		return nil
 	}
 
-	log.Printf("upgrading release: %s\n", stage.Release)
-	conn.UpgradeChart(stage.Chart, out)
+	timeout := stage.Timeout.Duration()
+	log.Printf("waiting for %s to become ready (timeout %s)\n", stage.Release, timeout)
+
+	waiter := kube.NewWaiter(kube.NewK8s())
+	if err := waiter.Wait(stage.Namespace, manifest, timeout); err != nil {
+		return fmt.Errorf("release %s did not become ready: %v", stage.Release, err)
+	}
+
+	log.Printf("release %s ready\n", stage.Release)
+	return nil
+}
+
+// render implements `compass render`: write the rendered manifest for
+// this stage to stdout, or to <Output>/<key>.yaml when Output is set,
+// without contacting Tiller.
+func (stage *Stage) render(key string, manifest []byte) error {
+	if stage.Output == "" {
+		fmt.Println(string(manifest))
+		return nil
+	}
+
+	if err := os.MkdirAll(stage.Output, 0755); err != nil {
+		return fmt.Errorf("failed to create output dir %s: %v", stage.Output, err)
+	}
+
+	path := filepath.Join(stage.Output, key+".yaml")
+	if err := ioutil.WriteFile(path, manifest, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+
+	log.Printf("rendered %s to %s\n", stage.Release, path)
+	return nil
+}
+
+// diff implements `compass diff`: fetch the release's currently deployed
+// manifest and print a unified diff against the freshly rendered one, so
+// a reviewer can see what a pipeline run would change before it runs.
+func (stage *Stage) diff(conn releaseClient, manifest []byte) error {
+	live, err := conn.GetReleaseManifest(stage.Release)
+	if err != nil {
+		return fmt.Errorf("failed to fetch deployed manifest for %s: %v", stage.Release, err)
+	}
+
+	unified := difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(live)),
+		B:        difflib.SplitLines(string(manifest)),
+		FromFile: fmt.Sprintf("%s (deployed)", stage.Release),
+		ToFile:   fmt.Sprintf("%s (rendered)", stage.Release),
+		Context:  3,
+	}
+
+	text, err := difflib.GetUnifiedDiffString(unified)
+	if err != nil {
+		return fmt.Errorf("failed to diff %s: %v", stage.Release, err)
+	}
+
+	if text == "" {
+		log.Printf("%s: no changes\n", stage.Release)
+		return nil
+	}
+
+	fmt.Print(text)
+	return nil
+}
+
+// dryRun implements `compass dry-run`: install or upgrade this stage
+// with Helm's dry-run flag set and print the server-side response
+// without persisting anything.
+func (stage *Stage) dryRun(conn releaseClient, manifest []byte) error {
+	_, err := conn.ReleaseStatus(stage.Release)
+
+	var (
+		response string
+		opErr    error
+	)
 	if err != nil {
-		log.Fatalf("failed to install %s : %s\n", stage.Release, err)
+		response, opErr = conn.InstallChartDryRun(stage.Chart, manifest)
+	} else {
+		response, opErr = conn.UpgradeChartDryRun(stage.Chart, manifest)
 	}
-	log.Printf("release upgraded: %s\n", stage.Release)
+	if opErr != nil {
+		return fmt.Errorf("dry-run failed for %s: %v", stage.Release, opErr)
+	}
+
+	fmt.Println(response)
 	return nil
 }
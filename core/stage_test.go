@@ -0,0 +1,197 @@
+package core
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/monax/compass/core/helm"
+)
+
+// fakeReleaseClient is a releaseClient test double: ReleaseStatus pops
+// statuses off a queue (so a test can script a pending release settling
+// across calls) while every other method just records that it ran and
+// returns the configured error.
+type fakeReleaseClient struct {
+	statuses  []helm.ReleaseStatus
+	statusErr error
+
+	installErr, upgradeErr, deleteErr, rollbackErr error
+	manifest                                       []byte
+	manifestErr                                    error
+
+	installed, upgraded, deleted, rolledBack int
+}
+
+func (f *fakeReleaseClient) ReleaseStatus(string) (helm.ReleaseStatus, error) {
+	if f.statusErr != nil {
+		return helm.Unknown, f.statusErr
+	}
+	if len(f.statuses) == 0 {
+		return helm.Unknown, errors.New("fakeReleaseClient: no more statuses queued")
+	}
+	s := f.statuses[0]
+	if len(f.statuses) > 1 {
+		f.statuses = f.statuses[1:]
+	}
+	return s, nil
+}
+
+func (f *fakeReleaseClient) InstallChart(helm.Chart, []byte) error {
+	f.installed++
+	return f.installErr
+}
+
+func (f *fakeReleaseClient) UpgradeChart(helm.Chart, []byte) error {
+	f.upgraded++
+	return f.upgradeErr
+}
+
+func (f *fakeReleaseClient) DeleteRelease(helm.Chart, string) error {
+	f.deleted++
+	return f.deleteErr
+}
+
+func (f *fakeReleaseClient) RollbackRelease(string) error {
+	f.rolledBack++
+	return f.rollbackErr
+}
+
+func (f *fakeReleaseClient) GetReleaseManifest(string) ([]byte, error) {
+	return f.manifest, f.manifestErr
+}
+
+func (f *fakeReleaseClient) InstallChartDryRun(helm.Chart, []byte) (string, error) {
+	return "", nil
+}
+
+func (f *fakeReleaseClient) UpgradeChartDryRun(helm.Chart, []byte) (string, error) {
+	return "", nil
+}
+
+func TestApplyStatusFailedRollsBackThenInstalls(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}}
+	conn := &fakeReleaseClient{}
+
+	err := stage.applyStatus(conn, []byte("manifest"), helm.Failed)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, conn.rolledBack)
+	assert.Equal(t, 1, conn.deleted, "Failed installs with deleteFirst=true")
+	assert.Equal(t, 1, conn.installed)
+	assert.Equal(t, 0, conn.upgraded)
+}
+
+func TestApplyStatusFailedRollbackError(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}}
+	conn := &fakeReleaseClient{rollbackErr: errors.New("boom")}
+
+	err := stage.applyStatus(conn, []byte("manifest"), helm.Failed)
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, conn.installed, "a failed rollback must not proceed to install")
+}
+
+func TestApplyStatusPendingInstall(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}}
+	conn := &fakeReleaseClient{}
+
+	err := stage.applyStatus(conn, []byte("manifest"), helm.PendingInstall)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, conn.deleted, "PendingInstall installs with deleteFirst=true")
+	assert.Equal(t, 1, conn.installed)
+}
+
+func TestApplyStatusDeployedUpgrades(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}}
+	conn := &fakeReleaseClient{}
+
+	err := stage.applyStatus(conn, []byte("manifest"), helm.Deployed)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, conn.upgraded)
+	assert.Equal(t, 0, conn.installed)
+}
+
+func TestApplyStatusPendingUpgradePurgeThenGone(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}, OnPending: "purge"}
+	conn := &fakeReleaseClient{statusErr: errors.New("release: not found")}
+
+	err := stage.applyStatus(conn, []byte("manifest"), helm.PendingUpgrade)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, conn.deleted, "purge deletes the stuck release")
+	assert.Equal(t, 1, conn.installed, "a purged release re-settles by installing fresh, not upgrading")
+	assert.Equal(t, 0, conn.upgraded)
+}
+
+func TestApplyStatusPendingUpgradeWaitThenSettled(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}, OnPending: "wait"}
+	// First ReleaseStatus call is resolvePending's own poll (settles
+	// immediately); the second is applyStatus re-fetching after it
+	// returns, which recurses into the Deployed/upgrade branch.
+	conn := &fakeReleaseClient{statuses: []helm.ReleaseStatus{helm.Deployed, helm.Deployed}}
+
+	err := stage.applyStatus(conn, []byte("manifest"), helm.PendingUpgrade)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, conn.upgraded, "a wait that settles Deployed must recurse into an upgrade, not assume one")
+}
+
+func TestApplyStatusPendingRollbackAbortDefault(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}} // OnPending unset defaults to abort
+	conn := &fakeReleaseClient{}
+
+	err := stage.applyStatus(conn, []byte("manifest"), helm.PendingRollback)
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, conn.installed)
+	assert.Equal(t, 0, conn.upgraded)
+	assert.Equal(t, 0, conn.deleted)
+}
+
+func TestResolvePendingUnknownPolicy(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}, OnPending: "explode"}
+	err := stage.resolvePending(&fakeReleaseClient{}, helm.PendingUpgrade)
+	assert.Error(t, err)
+}
+
+func TestStageRenderWritesToOutputDir(t *testing.T) {
+	stage := &Stage{Output: t.TempDir()}
+	manifest := []byte("kind: ConfigMap\n")
+
+	err := stage.render("my-stage", manifest)
+	assert.NoError(t, err)
+
+	got, err := ioutil.ReadFile(filepath.Join(stage.Output, "my-stage.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, manifest, got)
+}
+
+func TestStageDiffNoChanges(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}}
+	conn := &fakeReleaseClient{manifest: []byte("same\n")}
+
+	err := stage.diff(conn, []byte("same\n"))
+	assert.NoError(t, err)
+}
+
+func TestStageDiffChanged(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}}
+	conn := &fakeReleaseClient{manifest: []byte("old\n")}
+
+	err := stage.diff(conn, []byte("new\n"))
+	assert.NoError(t, err)
+}
+
+func TestStageDiffFetchError(t *testing.T) {
+	stage := &Stage{Chart: helm.Chart{Release: "web"}}
+	conn := &fakeReleaseClient{manifestErr: errors.New("tiller unreachable")}
+
+	err := stage.diff(conn, []byte("new\n"))
+	assert.Error(t, err)
+}